@@ -0,0 +1,182 @@
+package cloudstorage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Tar is a convenience function that takes a map of filenames and file
+// contents and wraps it into a single tarball, returning the tarred
+// file's byte slice.
+func Tar(files map[string][]byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := TarStream(buf, files); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// TarStream is the streaming form of Tar: it writes a tarball of files
+// directly to w instead of buffering the whole archive in memory first.
+func TarStream(w io.Writer, files map[string][]byte) error {
+	tarWriter := tar.NewWriter(w)
+	for filename, content := range files {
+		header := &tar.Header{
+			Name: filename,
+			Size: int64(len(content)),
+			Mode: 0644,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
+
+// UnTar is a convenience function that takes a tarball, untars it and
+// returns a map of the contents' filenames and contents as a byte slice
+func UnTar(file []byte) (map[string][]byte, error) {
+	return UnTarStream(bytes.NewReader(file))
+}
+
+// UnTarStream is the streaming form of UnTar: it reads a tarball from r
+// instead of requiring the whole archive to already be in memory.
+func UnTarStream(r io.Reader) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		result[header.Name] = content
+	}
+	return result, nil
+}
+
+// Gzip compresses data and returns the gzipped byte slice.
+func Gzip(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(buf)
+	if _, err := gzipWriter.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Gunzip decompresses gzipped data and returns the decompressed byte slice.
+func Gunzip(data []byte) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+	return ioutil.ReadAll(gzipReader)
+}
+
+// GzipStream wraps w in a gzip.Writer, compressing as the caller writes to
+// it instead of requiring the uncompressed payload to already be in
+// memory. The caller must Close the returned writer to flush the gzip
+// footer.
+func GzipStream(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+// GunzipStream wraps r in a gzip.Reader, decompressing as the caller reads
+// from it instead of requiring the whole gzipped payload to already be in
+// memory.
+func GunzipStream(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// Zip is a convenience function that takes a map of filenames and file contents
+// and wraps it into a single zipfile, returning the zipped file's byte slice
+func Zip(files map[string][]byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+	for filename, content := range files {
+		zipFile, err := zipWriter.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		_, err = zipFile.Write(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnZip is a convenience function that takes a zipfile, unzips it and returns
+// a map of the contents' filenames and contents as a byte slice
+func UnZip(file []byte) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	zipReader, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		return nil, err
+	}
+	for _, contentFile := range zipReader.File {
+		f, err := contentFile.Open()
+		if err != nil {
+			return nil, err
+		}
+		contentBytes, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		result[contentFile.Name] = contentBytes
+		f.Close()
+	}
+	return result, nil
+}
+
+// DecodeAuto decodes data based on path's extension, the way a backend's
+// GetFileAuto decodes whatever GetFile fetched: ".gz" is gunzipped, ".tar"
+// and ".zip" are unpacked into a map of filenames to contents, and
+// ".tar.gz"/".tgz" are gunzipped then untarred. Anything else is returned
+// as-is. The result is a []byte for a plain or gzipped file, or a
+// map[string][]byte for a tar or zip archive. It's a pure function of
+// path and data, independent of any backend, so that GetFileAuto
+// implementations across backends can share the same dispatch logic.
+func DecodeAuto(path string, data []byte) (interface{}, error) {
+	switch {
+	case strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz"):
+		gunzipped, err := Gunzip(data)
+		if err != nil {
+			return nil, err
+		}
+		return UnTar(gunzipped)
+	case strings.HasSuffix(path, ".gz"):
+		return Gunzip(data)
+	case strings.HasSuffix(path, ".tar"):
+		return UnTar(data)
+	case strings.HasSuffix(path, ".zip"):
+		return UnZip(data)
+	default:
+		return data, nil
+	}
+}
@@ -0,0 +1,109 @@
+package cloudstorage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarAndUnTar(t *testing.T) {
+	files := map[string][]byte{"file1": []byte("hello"), "file2": []byte("world")}
+	tarred, err := Tar(files)
+	assert.Nil(t, err)
+	untarred, err := UnTar(tarred)
+	assert.Nil(t, err)
+	assert.Equal(t, files, untarred)
+}
+
+func TestTarStreamAndUnTarStream(t *testing.T) {
+	files := map[string][]byte{"file1": []byte("hello")}
+	buf := new(bytes.Buffer)
+	assert.Nil(t, TarStream(buf, files))
+	untarred, err := UnTarStream(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, files, untarred)
+}
+
+func TestGzipAndGunzip(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	gzipped, err := Gzip(data)
+	assert.Nil(t, err)
+	gunzipped, err := Gunzip(gzipped)
+	assert.Nil(t, err)
+	assert.Equal(t, data, gunzipped)
+}
+
+func TestGzipStreamAndGunzipStream(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	buf := new(bytes.Buffer)
+	w := GzipStream(buf)
+	_, err := w.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+
+	r, err := GunzipStream(buf)
+	assert.Nil(t, err)
+	defer r.Close()
+	result, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, data, result)
+}
+
+func TestZipAndUnZip(t *testing.T) {
+	files := map[string][]byte{"file1": []byte("hello"), "file2": []byte("world")}
+	zipped, err := Zip(files)
+	assert.Nil(t, err)
+	unzipped, err := UnZip(zipped)
+	assert.Nil(t, err)
+	assert.Equal(t, files, unzipped)
+}
+
+func TestDecodeAutoPlainFile(t *testing.T) {
+	data := []byte("plain text")
+	result, err := DecodeAuto("notes.txt", data)
+	assert.Nil(t, err)
+	assert.Equal(t, data, result)
+}
+
+func TestDecodeAutoGzip(t *testing.T) {
+	data := []byte("the quick brown fox")
+	gzipped, err := Gzip(data)
+	assert.Nil(t, err)
+	result, err := DecodeAuto("file.gz", gzipped)
+	assert.Nil(t, err)
+	assert.Equal(t, data, result)
+}
+
+func TestDecodeAutoTar(t *testing.T) {
+	files := map[string][]byte{"file1": []byte("hello")}
+	tarred, err := Tar(files)
+	assert.Nil(t, err)
+	result, err := DecodeAuto("archive.tar", tarred)
+	assert.Nil(t, err)
+	assert.Equal(t, files, result)
+}
+
+func TestDecodeAutoZip(t *testing.T) {
+	files := map[string][]byte{"file1": []byte("hello")}
+	zipped, err := Zip(files)
+	assert.Nil(t, err)
+	result, err := DecodeAuto("archive.zip", zipped)
+	assert.Nil(t, err)
+	assert.Equal(t, files, result)
+}
+
+func TestDecodeAutoTarGzAndTgz(t *testing.T) {
+	files := map[string][]byte{"file1": []byte("hello")}
+	tarred, err := Tar(files)
+	assert.Nil(t, err)
+	gzipped, err := Gzip(tarred)
+	assert.Nil(t, err)
+
+	for _, path := range []string{"archive.tar.gz", "archive.tgz"} {
+		result, err := DecodeAuto(path, gzipped)
+		assert.Nil(t, err)
+		assert.Equal(t, files, result)
+	}
+}
@@ -0,0 +1,147 @@
+// Package azure is the Azure Blob Storage backend for
+// cloudstorage.ExternalStorage.
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/siegesmund/cloudstorage"
+)
+
+// Client implements cloudstorage.ExternalStorage.
+var _ cloudstorage.ExternalStorage = (*Client)(nil)
+
+func init() {
+	cloudstorage.Register("azure", func(uri *url.URL) (cloudstorage.ExternalStorage, error) {
+		return NewClient(os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_ACCESS_KEY"))
+	})
+}
+
+// Client wraps a single azblob.ServiceURL, built from an account name and
+// shared key by NewClient, so the pipeline is configured once and
+// reused across every operation instead of dialing on every call.
+type Client struct {
+	service azblob.ServiceURL
+}
+
+// NewClient dials a new Client for the given storage account using a
+// shared key credential.
+func NewClient(accountName, accountKey string) (*Client, error) {
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("azblob.NewSharedKeyCredential: %v", err)
+	}
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	serviceURL, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net", accountName))
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse: %v", err)
+	}
+	return &Client{service: azblob.NewServiceURL(*serviceURL, pipeline)}, nil
+}
+
+func (c *Client) blobURL(bucket, path string) azblob.BlockBlobURL {
+	return c.service.NewContainerURL(bucket).NewBlockBlobURL(path)
+}
+
+// PutFile puts a file to Azure Blob Storage and returns an error or nil
+func (c *Client) PutFile(bucket, path string, data []byte) error {
+	ctx := context.Background()
+	_, err := azblob.UploadBufferToBlockBlob(ctx, data, c.blobURL(bucket, path), azblob.UploadToBlockBlobOptions{})
+	if err != nil {
+		return fmt.Errorf("azblob.UploadBufferToBlockBlob: %v", err)
+	}
+	log.Printf("%v saved to %s/%s\n", path, bucket, path)
+	return nil
+}
+
+// GetFile fetches a file from Azure Blob Storage and returns a byte slice or an error
+func (c *Client) GetFile(bucket, path string) ([]byte, error) {
+	ctx := context.Background()
+	resp, err := c.blobURL(bucket, path).Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return nil, fmt.Errorf("BlockBlobURL.Download: %v", err)
+	}
+	body := resp.Body(azblob.RetryReaderOptions{})
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll: %v", err)
+	}
+	log.Printf("%v retrieved from %s/%s\n", path, bucket, path)
+	return data, nil
+}
+
+// Exists returns true if a file exists at the bucket and path arguments. It returns false otherwise.
+// If it encounters any other type of error, it panics
+func (c *Client) Exists(bucket, path string) bool {
+	ctx := context.Background()
+	_, err := c.blobURL(bucket, path).GetProperties(ctx, azblob.BlobAccessConditions{})
+	if err != nil {
+		if stgErr, ok := err.(azblob.StorageError); ok && stgErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			return false
+		}
+		log.Panic(err)
+	}
+	return true
+}
+
+// FilesAtPath returns a slice of FileMetadata that contains metadata about each blob. An optional
+// filter function can be passed in which case the results will be filtered according to the rules defined in the function
+func (c *Client) FilesAtPath(bucket, path string, filter ...func(object cloudstorage.FileMetadata) bool) ([]cloudstorage.FileMetadata, error) {
+	var result []cloudstorage.FileMetadata
+	ctx := context.Background()
+	containerURL := c.service.NewContainerURL(bucket)
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: path})
+		if err != nil {
+			return nil, fmt.Errorf("ContainerURL.ListBlobsFlatSegment: %v", err)
+		}
+		for _, blob := range resp.Segment.BlobItems {
+			var size int64
+			if blob.Properties.ContentLength != nil {
+				size = *blob.Properties.ContentLength
+			}
+			var contentType string
+			if blob.Properties.ContentType != nil {
+				contentType = *blob.Properties.ContentType
+			}
+			result = append(result, cloudstorage.FileMetadata{
+				Bucket:      bucket,
+				Name:        blob.Name,
+				Size:        size,
+				ContentType: contentType,
+				Updated:     blob.Properties.LastModified,
+			})
+		}
+		marker = resp.NextMarker
+	}
+	if len(filter) > 0 {
+		result = cloudstorage.FilterFiles(result, filter[0])
+	}
+	return result, nil
+}
+
+// ProcessFile performs a non-destructive operation on an Azure blob's data via the 'process' callback
+func (c *Client) ProcessFile(bucket, path string, process func(file []byte) error) error {
+	return cloudstorage.ProcessFile(c, bucket, path, process)
+}
+
+// ProcessAndUpdateFile fetches a blob from Azure, runs the 'process' callback, which must return
+// a byte slice containing the updated file, or an error. This byte slice is then put to Azure,
+// replacing the original blob.
+func (c *Client) ProcessAndUpdateFile(bucket, path string, process func(file []byte) ([]byte, error)) error {
+	return cloudstorage.ProcessAndUpdateFile(c, bucket, path, process)
+}
+
+// SaveNetworkFile fetches a file at a target url and puts it to the Azure Blob Storage destination
+// bucket and path. it returns a byte slice or nil and an error or nil.
+func (c *Client) SaveNetworkFile(targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error) {
+	return cloudstorage.SaveNetworkFile(c, targetUrl, destinationBucket, destinationPath, headers)
+}
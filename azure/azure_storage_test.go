@@ -0,0 +1,154 @@
+package azure
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer fakes just enough of the Azure Blob REST API - Put Blob,
+// Get Blob, Get Blob Properties, and List Blobs (flat segment) - for a
+// Client pointed at it to round-trip against, without a live storage
+// account.
+func newTestServer() (*httptest.Server, *sync.Map) {
+	var store sync.Map
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		container, blob := splitPath(r.URL.Path)
+
+		if blob == "" && r.URL.Query().Get("restype") == "container" && r.URL.Query().Get("comp") == "list" {
+			listBlobs(w, container, r.URL.Query().Get("prefix"), &store)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			data := make([]byte, r.ContentLength)
+			r.Body.Read(data)
+			store.Store(blob, data)
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodHead:
+			data, ok := store.Load(blob)
+			if !ok {
+				w.Header().Set("x-ms-error-code", string(azblob.ServiceCodeBlobNotFound))
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data.([]byte))))
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		case http.MethodGet:
+			data, ok := store.Load(blob)
+			if !ok {
+				w.Header().Set("x-ms-error-code", string(azblob.ServiceCodeBlobNotFound))
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			body := data.([]byte)
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Write(body)
+		}
+	})
+	return httptest.NewServer(mux), &store
+}
+
+func splitPath(path string) (container, blob string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	container = parts[0]
+	if len(parts) > 1 {
+		blob = parts[1]
+	}
+	return container, blob
+}
+
+func listBlobs(w http.ResponseWriter, container, prefix string, store *sync.Map) {
+	var blobs strings.Builder
+	store.Range(func(k, v interface{}) bool {
+		name := k.(string)
+		if strings.HasPrefix(name, prefix) {
+			fmt.Fprintf(&blobs, `<Blob><Name>%s</Name><Properties><Last-Modified>%s</Last-Modified><Content-Length>%d</Content-Length></Properties></Blob>`,
+				name, time.Now().UTC().Format(time.RFC1123), len(v.([]byte)))
+		}
+		return true
+	})
+	fmt.Fprintf(w, `<?xml version="1.0"?><EnumerationResults ContainerName="%s"><Prefix>%s</Prefix><Blobs>%s</Blobs><NextMarker/></EnumerationResults>`,
+		container, prefix, blobs.String())
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	credential, err := azblob.NewSharedKeyCredential("testaccount", base64.StdEncoding.EncodeToString([]byte("secret")))
+	assert.Nil(t, err)
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	serviceURL, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	return &Client{service: azblob.NewServiceURL(*serviceURL, pipeline)}
+}
+
+func TestPutFileAndGetFile(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	data := []byte("hello world")
+
+	assert.Nil(t, c.PutFile("mycontainer", "file.txt", data))
+	got, err := c.GetFile("mycontainer", "file.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestExists(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	assert.False(t, c.Exists("mycontainer", "missing.txt"))
+
+	assert.Nil(t, c.PutFile("mycontainer", "present.txt", []byte("x")))
+	assert.True(t, c.Exists("mycontainer", "present.txt"))
+}
+
+func TestFilesAtPath(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	assert.Nil(t, c.PutFile("mycontainer", "prefix/a.txt", []byte("a")))
+	assert.Nil(t, c.PutFile("mycontainer", "prefix/b.txt", []byte("bb")))
+	assert.Nil(t, c.PutFile("mycontainer", "other/c.txt", []byte("ccc")))
+
+	files, err := c.FilesAtPath("mycontainer", "prefix/")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files))
+}
+
+func TestProcessAndUpdateFile(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	assert.Nil(t, c.PutFile("mycontainer", "count.txt", []byte("1")))
+
+	err := c.ProcessAndUpdateFile("mycontainer", "count.txt", func(file []byte) ([]byte, error) {
+		return []byte(string(file) + "1"), nil
+	})
+	assert.Nil(t, err)
+
+	got, err := c.GetFile("mycontainer", "count.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "11", string(got))
+}
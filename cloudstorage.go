@@ -0,0 +1,164 @@
+// Package cloudstorage defines the common ExternalStorage surface
+// implemented by every backend this module supports, and a URI-based
+// factory, Open, that dispatches to whichever one is registered for the
+// scheme in question.
+package cloudstorage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FileMetadata describes an object in cloud storage in a way that's common
+// across every backend supported by this package - Google Cloud Storage,
+// S3, Azure Blob, and plain HTTPS.
+type FileMetadata struct {
+	Bucket      string
+	Name        string
+	Size        int64
+	ContentType string
+	Updated     time.Time
+}
+
+// FileName extracts the name of the file from the path
+func (f FileMetadata) FileName() string {
+	nameArray := strings.Split(f.Name, "/")
+	return nameArray[len(nameArray)-1]
+}
+
+// Get fetches the file this FileMetadata describes from store - the same
+// ExternalStorage backend it was returned from, by FilesAtPath.
+func (f FileMetadata) Get(store ExternalStorage) ([]byte, error) {
+	return store.GetFile(f.Bucket, f.Name)
+}
+
+// ExternalStorage is implemented by every cloud storage backend this
+// module supports, so that the Zip/UnZip/process helpers - and callers in
+// general - can operate against any of them without caring which one is in
+// play. See the google, s3, azure and httpstorage packages.
+type ExternalStorage interface {
+	PutFile(bucket, path string, data []byte) error
+	GetFile(bucket, path string) ([]byte, error)
+	Exists(bucket, path string) bool
+	FilesAtPath(bucket, path string, filter ...func(object FileMetadata) bool) ([]FileMetadata, error)
+	ProcessFile(bucket, path string, process func(file []byte) error) error
+	ProcessAndUpdateFile(bucket, path string, process func(file []byte) ([]byte, error)) error
+	SaveNetworkFile(targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error)
+}
+
+// FilterFiles returns the subset of files for which filter returns true,
+// preserving order. Every ExternalStorage backend's FilesAtPath uses this
+// to apply its optional filter argument, rather than removing elements
+// from files in place while ranging over it - which skips the element
+// immediately after one that was just removed.
+func FilterFiles(files []FileMetadata, filter func(object FileMetadata) bool) []FileMetadata {
+	result := make([]FileMetadata, 0, len(files))
+	for _, f := range files {
+		if filter(f) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// ProcessFile fetches the file at bucket/path from store and runs process
+// against its contents without writing anything back. It's implemented
+// once here, against the ExternalStorage interface, so that every
+// backend's ProcessFile method can delegate to it instead of re-typing
+// the same fetch-then-call logic.
+func ProcessFile(store ExternalStorage, bucket, path string, process func(file []byte) error) error {
+	data, err := store.GetFile(bucket, path)
+	if err != nil {
+		return err
+	}
+	return process(data)
+}
+
+// ProcessAndUpdateFile fetches the file at bucket/path from store, runs
+// the 'process' callback, which must return a byte slice containing the
+// updated file, or an error, and puts that byte slice back to store,
+// replacing the original object. It's implemented once here, against the
+// ExternalStorage interface, so that every backend's ProcessAndUpdateFile
+// method can delegate to it instead of re-typing the same logic.
+func ProcessAndUpdateFile(store ExternalStorage, bucket, path string, process func(file []byte) ([]byte, error)) error {
+	data, err := store.GetFile(bucket, path)
+	if err != nil {
+		return err
+	}
+	processedData, err := process(data)
+	if err != nil {
+		return err
+	}
+	return store.PutFile(bucket, path, processedData)
+}
+
+// SaveNetworkFile fetches a file at targetUrl and puts it to store at
+// destinationBucket/destinationPath, returning its contents. It's
+// implemented once here, against the ExternalStorage interface, so that
+// every backend's SaveNetworkFile method can delegate to it instead of
+// re-typing the same fetch-then-put logic.
+func SaveNetworkFile(store ExternalStorage, targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest("GET", targetUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for header, value := range headers {
+		req.Header.Add(header, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return body, store.PutFile(destinationBucket, destinationPath, body)
+}
+
+// Opener dials an ExternalStorage backend for a parsed URI.
+type Opener func(uri *url.URL) (ExternalStorage, error)
+
+var openers = make(map[string]Opener)
+
+// Register makes a backend available to Open under the given URI scheme.
+// It's called from the init function of each backend package (google, s3,
+// azure, httpstorage) and isn't normally called directly by users -
+// importing a backend package is enough to register it.
+func Register(scheme string, opener Opener) {
+	openers[scheme] = opener
+}
+
+// Open dispatches a URI such as "gs://bucket/prefix", "s3://bucket/prefix",
+// "azure://bucket/prefix" or "https://host/path" to the backend registered
+// for its scheme, returning the backend along with the bucket and the
+// path/prefix parsed out of the URI so callers can pass them straight to
+// the interface's methods. For http/https, httpstorage.Client expects a
+// full base URL rather than a bare host, so the bucket returned is
+// "scheme://host", not just the host, and prefix is the request path.
+func Open(uri string) (store ExternalStorage, bucket string, prefix string, err error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("cloudstorage.Open: %v", err)
+	}
+	opener, ok := openers[parsed.Scheme]
+	if !ok {
+		return nil, "", "", fmt.Errorf("cloudstorage.Open: no backend registered for scheme %q", parsed.Scheme)
+	}
+	store, err = opener(parsed)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("cloudstorage.Open: %v", err)
+	}
+	bucket = parsed.Host
+	prefix = strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Scheme == "http" || parsed.Scheme == "https" {
+		bucket = parsed.Scheme + "://" + parsed.Host
+		prefix = parsed.Path
+	}
+	return store, bucket, prefix, nil
+}
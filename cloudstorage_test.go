@@ -0,0 +1,84 @@
+package cloudstorage
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterFiles(t *testing.T) {
+	files := []FileMetadata{
+		{Name: "a"},
+		{Name: "b"},
+		{Name: "c"},
+		{Name: "d"},
+	}
+	filtered := FilterFiles(files, func(f FileMetadata) bool {
+		return f.Name != "b" && f.Name != "c"
+	})
+	assert.Equal(t, []FileMetadata{{Name: "a"}, {Name: "d"}}, filtered)
+}
+
+type fakeStorage struct{}
+
+func (fakeStorage) PutFile(bucket, path string, data []byte) error { return nil }
+func (fakeStorage) GetFile(bucket, path string) ([]byte, error)    { return nil, nil }
+func (fakeStorage) Exists(bucket, path string) bool                { return false }
+func (fakeStorage) FilesAtPath(bucket, path string, filter ...func(object FileMetadata) bool) ([]FileMetadata, error) {
+	return nil, nil
+}
+func (fakeStorage) ProcessFile(bucket, path string, process func(file []byte) error) error {
+	return nil
+}
+func (fakeStorage) ProcessAndUpdateFile(bucket, path string, process func(file []byte) ([]byte, error)) error {
+	return nil
+}
+func (fakeStorage) SaveNetworkFile(targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error) {
+	return nil, nil
+}
+
+func TestOpenDispatchesToRegisteredScheme(t *testing.T) {
+	var gotURI *url.URL
+	Register("fake", func(uri *url.URL) (ExternalStorage, error) {
+		gotURI = uri
+		return fakeStorage{}, nil
+	})
+	defer delete(openers, "fake")
+
+	store, bucket, prefix, err := Open("fake://mybucket/some/prefix")
+	assert.Nil(t, err)
+	assert.Equal(t, fakeStorage{}, store)
+	assert.Equal(t, "mybucket", bucket)
+	assert.Equal(t, "some/prefix", prefix)
+	assert.Equal(t, "mybucket", gotURI.Host)
+}
+
+func TestOpenHTTPSKeepsSchemeInBucket(t *testing.T) {
+	Register("https", func(uri *url.URL) (ExternalStorage, error) {
+		return fakeStorage{}, nil
+	})
+	defer delete(openers, "https")
+
+	store, bucket, prefix, err := Open("https://example.com/path/to/file")
+	assert.Nil(t, err)
+	assert.Equal(t, fakeStorage{}, store)
+	assert.Equal(t, "https://example.com", bucket)
+	assert.Equal(t, "/path/to/file", prefix)
+}
+
+func TestOpenUnregisteredScheme(t *testing.T) {
+	_, _, _, err := Open("nope://bucket/path")
+	assert.NotNil(t, err)
+}
+
+func TestOpenOpenerError(t *testing.T) {
+	Register("broken", func(uri *url.URL) (ExternalStorage, error) {
+		return nil, errors.New("boom")
+	})
+	defer delete(openers, "broken")
+
+	_, _, _, err := Open("broken://bucket/path")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,32 @@
+package google
+
+import (
+	"context"
+
+	"github.com/siegesmund/cloudstorage"
+)
+
+// GetFileAuto fetches a file from Google Cloud Storage and, based on its
+// extension, transparently decodes it - see cloudstorage.DecodeAuto. The
+// result is a []byte for a plain or gzipped file, or a map[string][]byte
+// for a tar or zip archive.
+func (c *Client) GetFileAuto(bucket, path string) (interface{}, error) {
+	data, err := c.GetFile(bucket, path)
+	if err != nil {
+		return nil, err
+	}
+	return cloudstorage.DecodeAuto(path, data)
+}
+
+// GetFileAuto fetches a file from Google Cloud Storage and transparently
+// decodes it based on its extension - see the Client method of the same
+// name. It uses the package-level default Client - see Configure.
+func GetFileAuto(bucket, path string) (interface{}, error) {
+	var result interface{}
+	err := withDefaultClient(context.Background(), func(c *Client) error {
+		var err error
+		result, err = c.GetFileAuto(bucket, path)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,201 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/siegesmund/cloudstorage"
+)
+
+// BatchOptions configures the concurrent batch operations in this file -
+// GetFiles, PutFiles, and ProcessAndUpdateFiles. The zero value runs with
+// context.Background, no progress callback, and writes enabled.
+type BatchOptions struct {
+	// Context, if set, is checked between objects so that cancelling it
+	// stops the batch early.
+	Context context.Context
+	// Progress, if set, is called after each object is processed (or
+	// would have been, in DryRun mode) with its path and any error.
+	Progress func(path string, err error)
+	// DryRun, if true, reports what PutFiles/ProcessAndUpdateFiles would
+	// write without actually writing it.
+	DryRun bool
+}
+
+func (o BatchOptions) context() context.Context {
+	if o.Context != nil {
+		return o.Context
+	}
+	return context.Background()
+}
+
+func firstBatchOptions(opts []BatchOptions) BatchOptions {
+	if len(opts) > 0 {
+		return opts[0]
+	}
+	return BatchOptions{}
+}
+
+// runConcurrent calls fn(ctx, i) for every i in [0, n) across concurrency
+// workers at a time, stopping early and returning the first error
+// encountered. ctx is canceled as soon as that first error is seen, so fn
+// should pass it on to whatever per-operation call it makes in order to
+// have an in-flight call interrupted rather than merely stopping new work
+// from starting.
+func runConcurrent(ctx context.Context, n, concurrency int, fn func(ctx context.Context, i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// GetFiles fetches every path in paths from bucket, fanning out across
+// concurrency workers, and returns a map from path to its contents. It
+// stops at the first error and returns it.
+func (c *Client) GetFiles(bucket string, paths []string, concurrency int, opts ...BatchOptions) (map[string][]byte, error) {
+	opt := firstBatchOptions(opts)
+	result := make(map[string][]byte, len(paths))
+	var mu sync.Mutex
+
+	err := runConcurrent(opt.context(), len(paths), concurrency, func(ctx context.Context, i int) error {
+		path := paths[i]
+		data, err := c.getFileContext(ctx, bucket, path)
+		if opt.Progress != nil {
+			opt.Progress(path, err)
+		}
+		if err != nil {
+			return fmt.Errorf("GetFile(%q): %v", path, err)
+		}
+		mu.Lock()
+		result[path] = data
+		mu.Unlock()
+		return nil
+	})
+	return result, err
+}
+
+// GetFiles fetches every path in paths from bucket, fanning out across
+// concurrency workers. It uses the package-level default Client - see
+// Configure.
+func GetFiles(bucket string, paths []string, concurrency int, opts ...BatchOptions) (map[string][]byte, error) {
+	var result map[string][]byte
+	err := withDefaultClient(context.Background(), func(c *Client) error {
+		var err error
+		result, err = c.GetFiles(bucket, paths, concurrency, opts...)
+		return err
+	})
+	return result, err
+}
+
+// PutFiles puts every file in files to bucket, fanning out across
+// concurrency workers. With opts.DryRun set, it reports what would be
+// written - via opts.Progress - without writing anything. It stops at the
+// first error and returns it.
+func (c *Client) PutFiles(bucket string, files map[string][]byte, concurrency int, opts ...BatchOptions) error {
+	opt := firstBatchOptions(opts)
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+
+	return runConcurrent(opt.context(), len(paths), concurrency, func(ctx context.Context, i int) error {
+		path := paths[i]
+		var err error
+		if !opt.DryRun {
+			err = c.putFileContext(ctx, bucket, path, files[path])
+		}
+		if opt.Progress != nil {
+			opt.Progress(path, err)
+		}
+		if err != nil {
+			return fmt.Errorf("PutFile(%q): %v", path, err)
+		}
+		return nil
+	})
+}
+
+// PutFiles puts every file in files to bucket, fanning out across
+// concurrency workers. It uses the package-level default Client - see
+// Configure.
+func PutFiles(bucket string, files map[string][]byte, concurrency int, opts ...BatchOptions) error {
+	return withDefaultClient(context.Background(), func(c *Client) error {
+		return c.PutFiles(bucket, files, concurrency, opts...)
+	})
+}
+
+// ProcessAndUpdateFiles lists the objects under prefix (optionally
+// narrowed by filter), then fans out across concurrency workers, running
+// process on each object's data and writing the result back - exactly
+// like ProcessAndUpdateFile, but for every matching object instead of one.
+// With opts.DryRun set, process still runs but its result is never
+// written. It stops at the first error and returns it.
+func (c *Client) ProcessAndUpdateFiles(bucket, prefix string, filter func(object cloudstorage.FileMetadata) bool, concurrency int, process func(path string, data []byte) ([]byte, error), opts ...BatchOptions) error {
+	opt := firstBatchOptions(opts)
+
+	var files []cloudstorage.FileMetadata
+	var err error
+	if filter != nil {
+		files, err = c.FilesAtPath(bucket, prefix, filter)
+	} else {
+		files, err = c.FilesAtPath(bucket, prefix)
+	}
+	if err != nil {
+		return err
+	}
+
+	return runConcurrent(opt.context(), len(files), concurrency, func(ctx context.Context, i int) error {
+		path := files[i].Name
+		data, err := c.getFileContext(ctx, bucket, path)
+		if err == nil {
+			var processed []byte
+			processed, err = process(path, data)
+			if err == nil && !opt.DryRun {
+				err = c.putFileContext(ctx, bucket, path, processed)
+			}
+		}
+		if opt.Progress != nil {
+			opt.Progress(path, err)
+		}
+		if err != nil {
+			return fmt.Errorf("%q: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// ProcessAndUpdateFiles lists the objects under prefix (optionally
+// narrowed by filter), then fans out across concurrency workers, running
+// process on each object's data and writing the result back. It uses the
+// package-level default Client - see Configure.
+func ProcessAndUpdateFiles(bucket, prefix string, filter func(object cloudstorage.FileMetadata) bool, concurrency int, process func(path string, data []byte) ([]byte, error), opts ...BatchOptions) error {
+	return withDefaultClient(context.Background(), func(c *Client) error {
+		return c.ProcessAndUpdateFiles(bucket, prefix, filter, concurrency, process, opts...)
+	})
+}
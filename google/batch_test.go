@@ -0,0 +1,87 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConcurrentStopsAtFirstError(t *testing.T) {
+	wantErr := errors.New("boom")
+
+	err := runConcurrent(context.Background(), 10, 2, func(ctx context.Context, i int) error {
+		if i == 3 {
+			return wantErr
+		}
+		return nil
+	})
+
+	assert.Equal(t, wantErr, err)
+}
+
+func TestRunConcurrentCancelsInFlightWork(t *testing.T) {
+	wantErr := errors.New("boom")
+
+	err := runConcurrent(context.Background(), 10, 2, func(ctx context.Context, i int) error {
+		if i == 0 {
+			return wantErr
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.Equal(t, wantErr, err)
+}
+
+func TestRunConcurrentRespectsConcurrency(t *testing.T) {
+	const concurrency = 3
+	var mu sync.Mutex
+	var current, max int
+
+	err := runConcurrent(context.Background(), 20, concurrency, func(ctx context.Context, i int) error {
+		mu.Lock()
+		current++
+		if current > max {
+			max = current
+		}
+		mu.Unlock()
+
+		mu.Lock()
+		current--
+		mu.Unlock()
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, max, concurrency)
+}
+
+func TestPutFilesDryRun(t *testing.T) {
+	c := &Client{}
+	files := map[string][]byte{
+		"one.json":   []byte("1"),
+		"two.json":   []byte("2"),
+		"three.json": []byte("3"),
+	}
+
+	seen := make(map[string]error)
+	var mu sync.Mutex
+
+	err := c.PutFiles("test-bucket", files, 2, BatchOptions{
+		DryRun: true,
+		Progress: func(path string, err error) {
+			mu.Lock()
+			seen[path] = err
+			mu.Unlock()
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, len(files), len(seen))
+	for path, err := range seen {
+		assert.Nil(t, err, path)
+	}
+}
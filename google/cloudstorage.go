@@ -1,41 +1,180 @@
 package google
 
 import (
-	"archive/zip"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
-	"strings"
+	"net/url"
+	"sync"
 	"time"
 
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 
 	"cloud.google.com/go/storage"
+
+	"github.com/siegesmund/cloudstorage"
 )
 
+// Client implements cloudstorage.ExternalStorage.
+var _ cloudstorage.ExternalStorage = (*Client)(nil)
+
+func init() {
+	cloudstorage.Register("gs", func(uri *url.URL) (cloudstorage.ExternalStorage, error) {
+		return NewClient(context.Background())
+	})
+}
+
 const Timeout = time.Second * 60
 
 // https://pkg.go.dev/cloud.google.com/go/storage#section-readme
 // https://cloud.google.com/appengine/docs/standard/go/using-cloud-storage
 // https://cloud.google.com/appengine/docs/standard/go111/googlecloudstorageclient/read-write-to-cloud-storage
 
-// PutFile puts a file to Google Cloud Storage and returns an error or nil
-func PutFile(bucket, path string, data []byte) error {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+// Client wraps a single *storage.Client so that its connection and
+// credentials can be configured once - via option.ClientOption - and reused
+// across every operation instead of dialing a new client on every call.
+// This is what makes App Engine / Cloud Run token sources, JWT configs
+// loaded with google.JWTConfigFromJSON, and replay transports for tests
+// possible: construct a Client with the option.ClientOption you need and
+// call its methods instead of the package-level functions.
+type Client struct {
+	storage *storage.Client
+}
+
+// NewClient dials a new Client using the given option.ClientOption values,
+// for example option.WithHTTPClient, option.WithTokenSource, or a replay
+// transport from cloud.google.com/go/httpreplay. With no options it behaves
+// like storage.NewClient and uses the default credential chain.
+func NewClient(ctx context.Context, opts ...option.ClientOption) (*Client, error) {
+	client, err := storage.NewClient(ctx, opts...)
 	if err != nil {
-		return fmt.Errorf("storage.NewClient: %v", err)
+		return nil, fmt.Errorf("storage.NewClient: %v", err)
+	}
+	return &Client{storage: client}, nil
+}
+
+// Close releases the resources held by the Client's underlying
+// *storage.Client.
+func (c *Client) Close() error {
+	return c.storage.Close()
+}
+
+var (
+	defaultClient   *Client
+	defaultClientMu sync.Mutex
+)
+
+// Configure sets the package-level default Client used by PutFile, GetFile,
+// and the other top-level functions in this package, so that a single
+// *storage.Client is reused across every call instead of dialing on every
+// request. Call Configure once, typically during program startup, before
+// using any of the top-level functions.
+func Configure(ctx context.Context, opts ...option.ClientOption) error {
+	client, err := NewClient(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defaultClientMu.Lock()
+	defaultClient = client
+	defaultClientMu.Unlock()
+	return nil
+}
+
+// withDefaultClient runs fn against the configured default Client. If
+// Configure hasn't been called, it falls back to dialing a one-off Client
+// with the default credential chain - preserving the historical behavior
+// of the top-level functions - and closes it once fn returns. Only use
+// this when fn's work, including any I/O, is finished before it returns;
+// for calls that hand the caller a live io.ReadCloser/io.WriteCloser to
+// use afterwards, use defaultClientForHandle instead so the fallback
+// client isn't closed out from under it.
+func withDefaultClient(ctx context.Context, fn func(*Client) error) error {
+	defaultClientMu.Lock()
+	client := defaultClient
+	defaultClientMu.Unlock()
+	if client != nil {
+		return fn(client)
+	}
+	client, err := NewClient(ctx)
+	if err != nil {
+		return err
 	}
 	defer client.Close()
+	return fn(client)
+}
+
+// defaultClientForHandle returns the configured default Client, or a
+// freshly dialed one when Configure hasn't been called. The returned
+// closeFn must be called once the caller is done with the Client - for
+// the default Client it's a no-op, but for a freshly dialed fallback
+// client it closes it. This is for NewReader/NewRangeReader/NewWriter,
+// which hand back a live handle that outlives this call, unlike
+// withDefaultClient's fn which must finish all its I/O before returning.
+func defaultClientForHandle(ctx context.Context) (client *Client, closeFn func() error, err error) {
+	defaultClientMu.Lock()
+	client = defaultClient
+	defaultClientMu.Unlock()
+	if client != nil {
+		return client, func() error { return nil }, nil
+	}
+	client, err = NewClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, client.Close, nil
+}
+
+// readCloserWithClient closes client once the wrapped io.ReadCloser is
+// closed, so a fallback Client dialed just for this handle isn't closed
+// out from under the caller before they're done reading.
+type readCloserWithClient struct {
+	io.ReadCloser
+	closeClient func() error
+}
+
+func (r *readCloserWithClient) Close() error {
+	err := r.ReadCloser.Close()
+	if cerr := r.closeClient(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeCloserWithClient closes client once the wrapped io.WriteCloser is
+// closed, so a fallback Client dialed just for this handle isn't closed
+// out from under the caller before they're done writing.
+type writeCloserWithClient struct {
+	io.WriteCloser
+	closeClient func() error
+}
+
+func (w *writeCloserWithClient) Close() error {
+	err := w.WriteCloser.Close()
+	if cerr := w.closeClient(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// PutFile puts a file to Google Cloud Storage and returns an error or nil
+func (c *Client) PutFile(bucket, path string, data []byte) error {
+	return c.putFileContext(context.Background(), bucket, path, data)
+}
+
+// putFileContext is PutFile with a caller-supplied parent context, so that
+// per-operation cancellation (see BatchOptions.Context in batch.go) can
+// interrupt an in-flight write instead of only stopping new work from
+// starting.
+func (c *Client) putFileContext(ctx context.Context, bucket, path string, data []byte) error {
 	ctx, cancel := context.WithTimeout(ctx, Timeout)
 	defer cancel()
 
-	wc := client.Bucket(bucket).Object(path).NewWriter(ctx)
-	if _, err = io.Copy(wc, bytes.NewReader(data)); err != nil {
+	wc := c.storage.Bucket(bucket).Object(path).NewWriter(ctx)
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
 		return fmt.Errorf("io.Copy: %v", err)
 	}
 	if err := wc.Close(); err != nil {
@@ -45,20 +184,29 @@ func PutFile(bucket, path string, data []byte) error {
 	return nil
 }
 
+// PutFile puts a file to Google Cloud Storage and returns an error or nil.
+// It uses the package-level default Client - see Configure.
+func PutFile(bucket, path string, data []byte) error {
+	return withDefaultClient(context.Background(), func(c *Client) error {
+		return c.PutFile(bucket, path, data)
+	})
+}
+
 // GetFile fetches a file from Google Cloud Storage and returns a byte slice or an error
 // https://cloud.google.com/storage/docs/samples/storage-download-file
-func GetFile(bucket, path string) ([]byte, error) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("storage.NewClient: %v", err)
-	}
-	defer client.Close()
+func (c *Client) GetFile(bucket, path string) ([]byte, error) {
+	return c.getFileContext(context.Background(), bucket, path)
+}
 
+// getFileContext is GetFile with a caller-supplied parent context, so that
+// per-operation cancellation (see BatchOptions.Context in batch.go) can
+// interrupt an in-flight read instead of only stopping new work from
+// starting.
+func (c *Client) getFileContext(ctx context.Context, bucket, path string) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(ctx, Timeout)
 	defer cancel()
 
-	rc, err := client.Bucket(bucket).Object(path).NewReader(ctx)
+	rc, err := c.storage.Bucket(bucket).Object(path).NewReader(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("Object(%q).NewReader: %v", path, err)
 	}
@@ -72,12 +220,102 @@ func GetFile(bucket, path string) ([]byte, error) {
 	return data, nil
 }
 
+// GetFile fetches a file from Google Cloud Storage and returns a byte slice
+// or an error. It uses the package-level default Client - see Configure.
+func GetFile(bucket, path string) ([]byte, error) {
+	var data []byte
+	err := withDefaultClient(context.Background(), func(c *Client) error {
+		var err error
+		data, err = c.GetFile(bucket, path)
+		return err
+	})
+	return data, err
+}
+
+// NewReader opens an io.ReadCloser streaming the file at bucket/path,
+// without ever materializing the whole object in memory the way GetFile
+// does. The caller is responsible for closing the returned reader.
+func (c *Client) NewReader(bucket, path string) (io.ReadCloser, error) {
+	rc, err := c.storage.Bucket(bucket).Object(path).NewReader(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Object(%q).NewReader: %v", path, err)
+	}
+	return rc, nil
+}
+
+// NewReader opens an io.ReadCloser streaming the file at bucket/path. It
+// uses the package-level default Client - see Configure. If Configure
+// hasn't been called, the Client dialed to serve this call is closed when
+// the returned reader is closed.
+func NewReader(bucket, path string) (io.ReadCloser, error) {
+	client, closeClient, err := defaultClientForHandle(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	rc, err := client.NewReader(bucket, path)
+	if err != nil {
+		closeClient()
+		return nil, err
+	}
+	return &readCloserWithClient{ReadCloser: rc, closeClient: closeClient}, nil
+}
+
+// NewRangeReader opens an io.ReadCloser streaming length bytes of the file
+// at bucket/path starting at offset. A negative length reads to the end of
+// the object. This lets callers download part of a large object instead of
+// the whole thing.
+func (c *Client) NewRangeReader(bucket, path string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := c.storage.Bucket(bucket).Object(path).NewRangeReader(context.Background(), offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("Object(%q).NewRangeReader: %v", path, err)
+	}
+	return rc, nil
+}
+
+// NewRangeReader opens an io.ReadCloser streaming length bytes of the file
+// at bucket/path starting at offset. It uses the package-level default
+// Client - see Configure. If Configure hasn't been called, the Client
+// dialed to serve this call is closed when the returned reader is closed.
+func NewRangeReader(bucket, path string, offset, length int64) (io.ReadCloser, error) {
+	client, closeClient, err := defaultClientForHandle(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	rc, err := client.NewRangeReader(bucket, path, offset, length)
+	if err != nil {
+		closeClient()
+		return nil, err
+	}
+	return &readCloserWithClient{ReadCloser: rc, closeClient: closeClient}, nil
+}
+
+// NewWriter opens an io.WriteCloser streaming to the file at bucket/path,
+// without requiring the caller to hold the whole object in memory the way
+// PutFile does. The caller must Close the returned writer to flush and
+// finalize the object.
+func (c *Client) NewWriter(bucket, path string) io.WriteCloser {
+	return c.storage.Bucket(bucket).Object(path).NewWriter(context.Background())
+}
+
+// NewWriter opens an io.WriteCloser streaming to the file at bucket/path.
+// It uses the package-level default Client - see Configure. If Configure
+// hasn't been called, the Client dialed to serve this call is closed when
+// the returned writer is closed.
+func NewWriter(bucket, path string) (io.WriteCloser, error) {
+	client, closeClient, err := defaultClientForHandle(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &writeCloserWithClient{WriteCloser: client.NewWriter(bucket, path), closeClient: closeClient}, nil
+}
+
 // Exists returns true if a file exists at the bucket and path arguments. It returns false otherwise.
 // If it encounters any other type of error, it panics
-func Exists(bucket, path string) bool {
-	ctx := context.Background()
-	client, _ := storage.NewClient(ctx)
-	_, err := client.Bucket(bucket).Object(path).Attrs(ctx)
+func (c *Client) Exists(bucket, path string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	_, err := c.storage.Bucket(bucket).Object(path).Attrs(ctx)
 	if err == storage.ErrObjectNotExist {
 		return false
 	}
@@ -87,38 +325,39 @@ func Exists(bucket, path string) bool {
 	return true
 }
 
-// FileMetadata wraps an ObjectAttrs object
-type FileMetadata struct {
-	storage.ObjectAttrs
-}
-
-// FileName extracts the name of the file from the path
-func (s FileMetadata) FileName() string {
-	nameArray := strings.Split(s.Name, "/")
-	return nameArray[len(nameArray)-1]
+// Exists returns true if a file exists at the bucket and path arguments. It
+// returns false otherwise. If it encounters any other type of error, it
+// panics. It uses the package-level default Client - see Configure.
+func Exists(bucket, path string) bool {
+	var exists bool
+	withDefaultClient(context.Background(), func(c *Client) error {
+		exists = c.Exists(bucket, path)
+		return nil
+	})
+	return exists
 }
 
-// Get fetches the referenced file from cloud storage
-func (s FileMetadata) Get() ([]byte, error) {
-	return GetFile(s.Bucket, s.Name)
+// toFileMetadata converts a GCS-specific ObjectAttrs into the backend-
+// agnostic cloudstorage.FileMetadata.
+func toFileMetadata(attrs *storage.ObjectAttrs) cloudstorage.FileMetadata {
+	return cloudstorage.FileMetadata{
+		Bucket:      attrs.Bucket,
+		Name:        attrs.Name,
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		Updated:     attrs.Updated,
+	}
 }
 
-// FilesAtPath returns a slice of StorageObjects that contains metadata about each object. An optional
+// FilesAtPath returns a slice of FileMetadata that contains metadata about each object. An optional
 // filter function can be passed in which case the results will be filtered according to the rules defined in the function
 // https://cloud.google.com/storage/docs/samples/storage-list-files-with-prefix#storage_list_files_with_prefix-go
-func FilesAtPath(bucket, path string, filter ...func(object FileMetadata) bool) ([]FileMetadata, error) {
-	var result []FileMetadata
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("storage.NewClient: %v", err)
-	}
-	defer client.Close()
-
-	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+func (c *Client) FilesAtPath(bucket, path string, filter ...func(object cloudstorage.FileMetadata) bool) ([]cloudstorage.FileMetadata, error) {
+	var result []cloudstorage.FileMetadata
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 	defer cancel()
 
-	it := client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: path})
+	it := c.storage.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: path})
 	for {
 		attrs, err := it.Next()
 		if err == iterator.Done {
@@ -127,115 +366,146 @@ func FilesAtPath(bucket, path string, filter ...func(object FileMetadata) bool)
 		if err != nil {
 			return nil, fmt.Errorf("Bucket(%q).Objects: %v", bucket, err)
 		}
-		storageObject := FileMetadata{*attrs}
+		storageObject := toFileMetadata(attrs)
 		if storageObject.FileName() != "" {
 			result = append(result, storageObject)
 		}
 	}
 	// If a filter function was passed as an argument, use it to filter the result set
 	if len(filter) > 0 {
-		for i, object := range result {
-			// If the object does not meet the filter condition...
-			if !filter[0](object) {
-				// remove it: (inefficient but this approach preserves order)
-				result = append(result[:i], result[i+1:]...)
-			}
-		}
+		result = cloudstorage.FilterFiles(result, filter[0])
 	}
 	return result, nil
 }
 
+// FilesAtPath returns a slice of FileMetadata that contains metadata about
+// each object. It uses the package-level default Client - see Configure.
+func FilesAtPath(bucket, path string, filter ...func(object cloudstorage.FileMetadata) bool) ([]cloudstorage.FileMetadata, error) {
+	var result []cloudstorage.FileMetadata
+	err := withDefaultClient(context.Background(), func(c *Client) error {
+		var err error
+		result, err = c.FilesAtPath(bucket, path, filter...)
+		return err
+	})
+	return result, err
+}
+
 // ProcessFile performs a non-destructive operation on a cloud storage file's data via the 'process' callback
 // While it's possible to alter the file on cloud storage within the 'process' callback, there is a separate
 // function, ProcessAndUpdateFile, that moves any change to the cloud storage object out of the callback
+func (c *Client) ProcessFile(bucket, path string, process func(file []byte) error) error {
+	return cloudstorage.ProcessFile(c, bucket, path, process)
+}
+
+// ProcessFile performs a non-destructive operation on a cloud storage file's
+// data via the 'process' callback. It uses the package-level default Client
+// - see Configure.
 func ProcessFile(bucket, path string, process func(file []byte) error) error {
-	data, err := GetFile(bucket, path)
-	if err != nil {
-		return err
-	}
-	return process(data)
+	return withDefaultClient(context.Background(), func(c *Client) error {
+		return c.ProcessFile(bucket, path, process)
+	})
 }
 
 // ProcessAndUpdateFile fetches a file from cloud storage, runs the 'process' callback, which must return
 // a byte slice containing the updated file, or an error. This byte slice is then put to cloud storage,
 // replacing the original object.
+func (c *Client) ProcessAndUpdateFile(bucket, path string, process func(file []byte) ([]byte, error)) error {
+	return cloudstorage.ProcessAndUpdateFile(c, bucket, path, process)
+}
+
+// ProcessAndUpdateFile fetches a file from cloud storage, runs the 'process'
+// callback, and puts the result back to cloud storage, replacing the
+// original object. It uses the package-level default Client - see
+// Configure.
 func ProcessAndUpdateFile(bucket, path string, process func(file []byte) ([]byte, error)) error {
-	data, err := GetFile(bucket, path)
-	if err != nil {
-		return err
+	return withDefaultClient(context.Background(), func(c *Client) error {
+		return c.ProcessAndUpdateFile(bucket, path, process)
+	})
+}
+
+// abortableWriter is the subset of *storage.Writer that pipeProcessToWriter
+// needs - satisfied by the real GCS writer in production and by a fake in
+// tests, so the pipe-glue logic can be exercised without a live bucket.
+type abortableWriter interface {
+	io.Writer
+	Close() error
+	CloseWithError(err error) error
+}
+
+// pipeProcessToWriter runs process against an io.Pipe and copies whatever
+// it writes into writer, aborting both ends of the pipe - not just writer -
+// on a copy failure, so a process that performs more than one Write can't
+// block forever on a reader that's already gone.
+func pipeProcessToWriter(reader io.Reader, writer abortableWriter, process func(r io.Reader, w io.Writer) error) error {
+	pr, pw := io.Pipe()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- process(reader, pw)
+		pw.Close()
+	}()
+
+	if _, err := io.Copy(writer, pr); err != nil {
+		writer.CloseWithError(err)
+		pr.CloseWithError(err)
+		return fmt.Errorf("io.Copy: %v", err)
 	}
-	processedData, err := process(data)
-	if err != nil {
+	if err := <-errCh; err != nil {
+		writer.CloseWithError(err)
 		return err
 	}
-	return PutFile(bucket, path, processedData)
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("Writer.Close: %v", err)
+	}
+	return nil
 }
 
-// SaveNetworkFile fetches a file at a target url and puts it to the Google Cloud Storage destination
-// bucket and path. it returns a byte slice or nil and an error or nil.
-func SaveNetworkFile(targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error) {
-	client := http.Client{}
-	req, err := http.NewRequest("GET", targetUrl, nil)
-	if headers != nil {
-		for header, value := range headers {
-			req.Header.Add(header, value)
-		}
-	}
-	if err != nil {
-		return nil, err
-	}
-	result, err := client.Do(req)
+// ProcessAndUpdateFileStream streams a file from cloud storage into the 'process' callback's reader
+// and streams whatever the callback writes straight back to cloud storage, replacing the original
+// object, without ever buffering the whole object in memory the way ProcessAndUpdateFile does. If
+// process or the copy back to cloud storage fails, the write is aborted rather than committed, so
+// the original object is left untouched - matching ProcessAndUpdateFile, which never calls PutFile
+// at all when process errors.
+func (c *Client) ProcessAndUpdateFileStream(bucket, path string, process func(r io.Reader, w io.Writer) error) error {
+	reader, err := c.NewReader(bucket, path)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer result.Body.Close()
-	body, err := ioutil.ReadAll(result.Body)
-	if err != nil {
-		return nil, err
+	defer reader.Close()
+
+	writer := c.storage.Bucket(bucket).Object(path).NewWriter(context.Background())
+	if err := pipeProcessToWriter(reader, writer, process); err != nil {
+		return err
 	}
-	return body, PutFile(destinationBucket, destinationPath, body)
+	log.Printf("%v updated at %s/%s\n", path, bucket, path)
+	return nil
 }
 
-// Zip is a convenience function that takes a map of filenames and file contents
-// and wraps it into a single zipfile, returning the zipped file's byte slice
-func Zip(files map[string][]byte) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	zipWriter := zip.NewWriter(buf)
-	for filename, content := range files {
-		zipFile, err := zipWriter.Create(filename)
-		if err != nil {
-			return nil, err
-		}
-		_, err = zipFile.Write(content)
-		if err != nil {
-			return nil, err
-		}
-	}
-	if err := zipWriter.Close(); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+// ProcessAndUpdateFileStream streams a file from cloud storage through the
+// 'process' callback and back, replacing the original object. It uses the
+// package-level default Client - see Configure.
+func ProcessAndUpdateFileStream(bucket, path string, process func(r io.Reader, w io.Writer) error) error {
+	return withDefaultClient(context.Background(), func(c *Client) error {
+		return c.ProcessAndUpdateFileStream(bucket, path, process)
+	})
 }
 
-// UnZip is a convenience function that takes a zipfile, unzips it and returns
-// a map of the contents' filenames and contents as a byte slice
-func UnZip(file []byte) (map[string][]byte, error) {
-	result := make(map[string][]byte)
-	zipReader, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
-	if err != nil {
-		return nil, err
-	}
-	for _, contentFile := range zipReader.File {
-		f, err := contentFile.Open()
-		if err != nil {
-			return nil, err
-		}
-		contentBytes, err := ioutil.ReadAll(f)
-		if err != nil {
-			return nil, err
-		}
-		result[contentFile.Name] = contentBytes
-		f.Close()
-	}
-	return result, nil
+// SaveNetworkFile fetches a file at a target url and puts it to the Google Cloud Storage destination
+// bucket and path. it returns a byte slice or nil and an error or nil.
+func (c *Client) SaveNetworkFile(targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error) {
+	return cloudstorage.SaveNetworkFile(c, targetUrl, destinationBucket, destinationPath, headers)
+}
+
+// SaveNetworkFile fetches a file at a target url and puts it to the Google
+// Cloud Storage destination bucket and path. it returns a byte slice or nil
+// and an error or nil. It uses the package-level default Client - see
+// Configure.
+func SaveNetworkFile(targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error) {
+	var body []byte
+	err := withDefaultClient(context.Background(), func(c *Client) error {
+		var err error
+		body, err = c.SaveNetworkFile(targetUrl, destinationBucket, destinationPath, headers)
+		return err
+	})
+	return body, err
 }
@@ -3,15 +3,29 @@ package google
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
-	"cloud.google.com/go/storage"
-
 	"github.com/stretchr/testify/assert"
+
+	"github.com/siegesmund/cloudstorage"
+	"github.com/siegesmund/cloudstorage/testutil"
 )
 
+// record, when set via "-record", captures new testdata/*.replay files
+// against the live bucket below instead of replaying the existing ones -
+// see the testutil package.
+var record = flag.Bool("record", false, "record new httpreplay testdata instead of replaying it")
+
+const replayFile = "testdata/cloudstorage.replay"
+
 // Change this as necessary to run tests
 const bucket = "storage-package-test"
 const targetURL = "http://mysafeinfo.com/api/data?list=englishmonarchs&format=json"
@@ -71,10 +85,46 @@ func testData() []byte {
 	return bytes
 }
 
+var closeReplay func() error
+
+// networkTestsSkipReason is set in TestMain when the tests that talk to
+// bucket - directly or via the replay fixture - can't run, so that those
+// tests can skip themselves with skipIfNoNetwork while tests that don't
+// touch a bucket (e.g. the batch tests in batch_test.go and
+// TestPipeProcessToWriterAbortsPipeOnWriteFailure) still run.
+var networkTestsSkipReason string
+
+func skipIfNoNetwork(t *testing.T) {
+	if networkTestsSkipReason != "" {
+		t.Skip(networkTestsSkipReason)
+	}
+}
+
 func TestMain(m *testing.M) {
+	flag.Parse()
+	if !*record {
+		if _, err := os.Stat(replayFile); err != nil {
+			networkTestsSkipReason = fmt.Sprintf("%s not found - run \"go test ./google/... -record\" against a "+
+				"live %s bucket to record it, then commit the result", replayFile, bucket)
+			log.Print(networkTestsSkipReason)
+			os.Exit(m.Run())
+		}
+	}
+	ctx := context.Background()
+	opt, closeFn, err := testutil.Open(ctx, replayFile, *record)
+	if err != nil {
+		panic(err)
+	}
+	closeReplay = closeFn
+	if err := Configure(ctx, opt); err != nil {
+		panic(err)
+	}
 	setup()
 	code := m.Run()
 	teardown()
+	if err := closeReplay(); err != nil {
+		panic(err)
+	}
 	os.Exit(code)
 }
 
@@ -88,36 +138,35 @@ func setup() {
 }
 
 func teardown() {
-	ctx := context.Background()
-	client, _ := storage.NewClient(ctx)
-	defer client.Close()
-	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	o := client.Bucket(bucket).Object(networkTemp)
+	o := defaultClient.storage.Bucket(bucket).Object(networkTemp)
 	if err := o.Delete(ctx); err != nil {
 		panic(err)
 	}
-	o2 := client.Bucket(bucket).Object(putTemp)
+	o2 := defaultClient.storage.Bucket(bucket).Object(putTemp)
 	if err := o2.Delete(ctx); err != nil {
 		panic(err)
 	}
-	o3 := client.Bucket(bucket).Object(updateTemp)
+	o3 := defaultClient.storage.Bucket(bucket).Object(updateTemp)
 	if err := o3.Delete(ctx); err != nil {
 		panic(err)
 	}
-	o4 := client.Bucket(bucket).Object(zipTemp)
+	o4 := defaultClient.storage.Bucket(bucket).Object(zipTemp)
 	if err := o4.Delete(ctx); err != nil {
 		panic(err)
 	}
 }
 
 func TestGetFile(t *testing.T) {
+	skipIfNoNetwork(t)
 	file, _ := GetFile(bucket, filename)
 	result := unmarshal(file)
 	assert.Equal(t, result[0]["Reign"].(string), "899-925")
 }
 
 func TestPutFile(t *testing.T) {
+	skipIfNoNetwork(t)
 	err := PutFile(bucket, putTemp, testData())
 	assert.Nil(t, err)
 	assert.True(t, Exists(bucket, putTemp))
@@ -126,12 +175,14 @@ func TestPutFile(t *testing.T) {
 }
 
 func TestFilesAtPath(t *testing.T) {
+	skipIfNoNetwork(t)
 	files, _ := FilesAtPath(bucket, filename)
 	assert.Equal(t, 1, len(files))
 	assert.Equal(t, files[0].FileName(), filename)
 }
 
 func TestProcessFile(t *testing.T) {
+	skipIfNoNetwork(t)
 	var testField string
 	ProcessFile(bucket, filename, func(data []byte) error {
 		testField = unmarshal(data)[1]["Name"].(string)
@@ -141,6 +192,7 @@ func TestProcessFile(t *testing.T) {
 }
 
 func TestProcessAndUpdateFile(t *testing.T) {
+	skipIfNoNetwork(t)
 	err := ProcessAndUpdateFile(bucket, updateTemp, func(file []byte) ([]byte, error) {
 		object := unmarshal(file)
 		object[0]["Country"] = "Wessex"
@@ -154,14 +206,62 @@ func TestProcessAndUpdateFile(t *testing.T) {
 }
 
 func TestZipAndUnZip(t *testing.T) {
+	skipIfNoNetwork(t)
 	file1 := testData()
 	file2 := testData()
 	files := map[string][]byte{"file1": file1, "file2": file2}
-	zippedBytes, _ := Zip(files)
+	zippedBytes, _ := cloudstorage.Zip(files)
 	PutFile(bucket, zipTemp, zippedBytes)
 	result, _ := GetFile(bucket, zipTemp)
-	unZipped, _ := UnZip(result)
+	unZipped, _ := cloudstorage.UnZip(result)
 	assert.Equal(t, 2, len(unZipped))
 	assert.Equal(t, file1, unZipped["file1"])
 	assert.Equal(t, file2, unZipped["file2"])
 }
+
+// erroringWriter fails its first Write, simulating a destination-write
+// failure partway through a stream, e.g. a quota error or network blip.
+type erroringWriter struct {
+	closedWithErr error
+}
+
+func (w *erroringWriter) Write(p []byte) (int, error) {
+	if w.closedWithErr == nil {
+		return 0, errors.New("simulated write failure")
+	}
+	return len(p), nil
+}
+
+func (w *erroringWriter) Close() error { return nil }
+
+func (w *erroringWriter) CloseWithError(err error) error {
+	w.closedWithErr = err
+	return nil
+}
+
+// TestPipeProcessToWriterAbortsPipeOnWriteFailure guards against the pipe
+// leak this function used to have: if the copy to the destination writer
+// failed, only the writer was aborted, not the io.Pipe - so a process that
+// performed more than one Write would block forever on its second Write,
+// leaking the producer goroutine.
+func TestPipeProcessToWriterAbortsPipeOnWriteFailure(t *testing.T) {
+	writer := &erroringWriter{}
+	done := make(chan error, 1)
+	go func() {
+		done <- pipeProcessToWriter(strings.NewReader("irrelevant"), writer, func(r io.Reader, w io.Writer) error {
+			if _, err := w.Write([]byte("first")); err != nil {
+				return err
+			}
+			_, err := w.Write([]byte("second"))
+			return err
+		})
+	}()
+
+	select {
+	case err := <-done:
+		assert.NotNil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("pipeProcessToWriter did not return - producer goroutine likely leaked")
+	}
+	assert.NotNil(t, writer.closedWithErr)
+}
@@ -0,0 +1,114 @@
+// Package httpstorage is the plain HTTPS backend for
+// cloudstorage.ExternalStorage, for data that lives behind an ordinary web
+// server rather than GCS, S3, or Azure Blob.
+package httpstorage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/siegesmund/cloudstorage"
+)
+
+// Client implements cloudstorage.ExternalStorage.
+var _ cloudstorage.ExternalStorage = (*Client)(nil)
+
+func init() {
+	opener := func(uri *url.URL) (cloudstorage.ExternalStorage, error) { return NewClient(), nil }
+	cloudstorage.Register("http", opener)
+	cloudstorage.Register("https", opener)
+}
+
+// Client performs plain HTTP(S) GET/PUT/HEAD requests against a base URL -
+// the "bucket" - so that the same ExternalStorage surface works against
+// data sitting behind an ordinary web server.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a Client that issues requests with http.Client's zero
+// value (no special transport or timeout).
+func NewClient() *Client {
+	return &Client{http: &http.Client{}}
+}
+
+func (c *Client) url(bucket, path string) string {
+	return strings.TrimRight(bucket, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// PutFile PUTs a file to the destination url and returns an error or nil
+func (c *Client) PutFile(bucket, path string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, c.url(bucket, path), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("httpstorage: PUT %s: %s", req.URL, resp.Status)
+	}
+	log.Printf("%v saved to %s/%s\n", path, bucket, path)
+	return nil
+}
+
+// GetFile fetches a file from the source url and returns a byte slice or an error
+func (c *Client) GetFile(bucket, path string) ([]byte, error) {
+	target := c.url(bucket, path)
+	resp, err := c.http.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("httpstorage: GET %s: %s", target, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%v retrieved from %s/%s\n", path, bucket, path)
+	return data, nil
+}
+
+// Exists returns true if a HEAD request against the url succeeds. It returns false otherwise.
+// If it encounters any other type of error, it panics
+func (c *Client) Exists(bucket, path string) bool {
+	resp, err := c.http.Head(c.url(bucket, path))
+	if err != nil {
+		log.Panic(err)
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode < 300
+}
+
+// FilesAtPath is not supported over plain HTTP, which has no notion of
+// listing a prefix, and always returns an error.
+func (c *Client) FilesAtPath(bucket, path string, filter ...func(object cloudstorage.FileMetadata) bool) ([]cloudstorage.FileMetadata, error) {
+	return nil, fmt.Errorf("httpstorage: FilesAtPath is not supported over plain HTTP")
+}
+
+// ProcessFile performs a non-destructive operation on a file's data via the 'process' callback
+func (c *Client) ProcessFile(bucket, path string, process func(file []byte) error) error {
+	return cloudstorage.ProcessFile(c, bucket, path, process)
+}
+
+// ProcessAndUpdateFile fetches a file, runs the 'process' callback, which must return
+// a byte slice containing the updated file, or an error. This byte slice is then PUT back,
+// replacing the original file.
+func (c *Client) ProcessAndUpdateFile(bucket, path string, process func(file []byte) ([]byte, error)) error {
+	return cloudstorage.ProcessAndUpdateFile(c, bucket, path, process)
+}
+
+// SaveNetworkFile fetches a file at a target url and puts it to the destination
+// bucket and path. it returns a byte slice or nil and an error or nil.
+func (c *Client) SaveNetworkFile(targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error) {
+	return cloudstorage.SaveNetworkFile(c, targetUrl, destinationBucket, destinationPath, headers)
+}
@@ -0,0 +1,99 @@
+package httpstorage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer() (*httptest.Server, *sync.Map) {
+	var store sync.Map
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			store.Store(r.URL.Path, body)
+		case http.MethodGet, http.MethodHead:
+			data, ok := store.Load(r.URL.Path)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method == http.MethodGet {
+				w.Write(data.([]byte))
+			}
+		}
+	})
+	return httptest.NewServer(mux), &store
+}
+
+func TestPutFileAndGetFile(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := NewClient()
+	data := []byte("hello world")
+
+	assert.Nil(t, c.PutFile(server.URL, "file.txt", data))
+	got, err := c.GetFile(server.URL, "file.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestExists(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := NewClient()
+	assert.False(t, c.Exists(server.URL, "missing.txt"))
+
+	assert.Nil(t, c.PutFile(server.URL, "present.txt", []byte("x")))
+	assert.True(t, c.Exists(server.URL, "present.txt"))
+}
+
+func TestProcessAndUpdateFile(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := NewClient()
+	assert.Nil(t, c.PutFile(server.URL, "count.txt", []byte("1")))
+
+	err := c.ProcessAndUpdateFile(server.URL, "count.txt", func(file []byte) ([]byte, error) {
+		return []byte(string(file) + "1"), nil
+	})
+	assert.Nil(t, err)
+
+	got, err := c.GetFile(server.URL, "count.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "11", string(got))
+}
+
+func TestSaveNetworkFile(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("network data"))
+	}))
+	defer source.Close()
+
+	dest, _ := newTestServer()
+	defer dest.Close()
+
+	c := NewClient()
+	body, err := c.SaveNetworkFile(source.URL, dest.URL, "saved.txt", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "network data", string(body))
+
+	got, err := c.GetFile(dest.URL, "saved.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "network data", string(got))
+}
+
+func TestFilesAtPathUnsupported(t *testing.T) {
+	c := NewClient()
+	_, err := c.FilesAtPath("http://example.com", "prefix")
+	assert.NotNil(t, err)
+}
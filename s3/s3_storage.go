@@ -0,0 +1,140 @@
+// Package s3 is the S3 backend for cloudstorage.ExternalStorage.
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/siegesmund/cloudstorage"
+)
+
+// Client implements cloudstorage.ExternalStorage.
+var _ cloudstorage.ExternalStorage = (*Client)(nil)
+
+func init() {
+	cloudstorage.Register("s3", func(uri *url.URL) (cloudstorage.ExternalStorage, error) {
+		return NewClient()
+	})
+}
+
+// Client wraps a single *s3.S3, plus the upload/download managers built on
+// top of it, so that the AWS session and credentials are configured once
+// and reused across every operation instead of dialing on every call.
+type Client struct {
+	s3         *s3.S3
+	uploader   *s3manager.Uploader
+	downloader *s3manager.Downloader
+}
+
+// NewClient dials a new Client using the default AWS session (environment
+// variables, shared config, or an EC2/ECS role). Pass *aws.Config overrides
+// via opts, for example aws.NewConfig().WithRegion or
+// aws.NewConfig().WithCredentials for a replay/mock transport in tests.
+func NewClient(opts ...*aws.Config) (*Client, error) {
+	sess, err := session.NewSession(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("session.NewSession: %v", err)
+	}
+	return &Client{
+		s3:         s3.New(sess),
+		uploader:   s3manager.NewUploader(sess),
+		downloader: s3manager.NewDownloader(sess),
+	}, nil
+}
+
+// PutFile puts a file to S3 and returns an error or nil
+func (c *Client) PutFile(bucket, path string, data []byte) error {
+	_, err := c.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(path),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("s3manager.Upload: %v", err)
+	}
+	log.Printf("%v saved to %s/%s\n", path, bucket, path)
+	return nil
+}
+
+// GetFile fetches a file from S3 and returns a byte slice or an error
+func (c *Client) GetFile(bucket, path string) ([]byte, error) {
+	buf := aws.NewWriteAtBuffer([]byte{})
+	_, err := c.downloader.Download(buf, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3manager.Download: %v", err)
+	}
+	log.Printf("%v retrieved from %s/%s\n", path, bucket, path)
+	return buf.Bytes(), nil
+}
+
+// Exists returns true if a file exists at the bucket and path arguments. It returns false otherwise.
+// If it encounters any other type of error, it panics
+func (c *Client) Exists(bucket, path string) bool {
+	_, err := c.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+			return false
+		}
+		log.Panic(err)
+	}
+	return true
+}
+
+// FilesAtPath returns a slice of FileMetadata that contains metadata about each object. An optional
+// filter function can be passed in which case the results will be filtered according to the rules defined in the function
+func (c *Client) FilesAtPath(bucket, path string, filter ...func(object cloudstorage.FileMetadata) bool) ([]cloudstorage.FileMetadata, error) {
+	var result []cloudstorage.FileMetadata
+	err := c.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(path),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			result = append(result, cloudstorage.FileMetadata{
+				Bucket:  bucket,
+				Name:    aws.StringValue(object.Key),
+				Size:    aws.Int64Value(object.Size),
+				Updated: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3.ListObjectsV2Pages: %v", err)
+	}
+	if len(filter) > 0 {
+		result = cloudstorage.FilterFiles(result, filter[0])
+	}
+	return result, nil
+}
+
+// ProcessFile performs a non-destructive operation on an S3 file's data via the 'process' callback
+func (c *Client) ProcessFile(bucket, path string, process func(file []byte) error) error {
+	return cloudstorage.ProcessFile(c, bucket, path, process)
+}
+
+// ProcessAndUpdateFile fetches a file from S3, runs the 'process' callback, which must return
+// a byte slice containing the updated file, or an error. This byte slice is then put to S3,
+// replacing the original object.
+func (c *Client) ProcessAndUpdateFile(bucket, path string, process func(file []byte) ([]byte, error)) error {
+	return cloudstorage.ProcessAndUpdateFile(c, bucket, path, process)
+}
+
+// SaveNetworkFile fetches a file at a target url and puts it to the S3 destination
+// bucket and path. it returns a byte slice or nil and an error or nil.
+func (c *Client) SaveNetworkFile(targetUrl, destinationBucket, destinationPath string, headers map[string]string) ([]byte, error) {
+	return cloudstorage.SaveNetworkFile(c, targetUrl, destinationBucket, destinationPath, headers)
+}
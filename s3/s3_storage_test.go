@@ -0,0 +1,151 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer fakes just enough of the S3 REST API - PutObject,
+// GetObject (including the ranged GETs s3manager.Downloader issues),
+// HeadObject, and ListObjectsV2 - for a Client built with NewClient to
+// round-trip against, without a live AWS account.
+func newTestServer() (*httptest.Server, *sync.Map) {
+	var store sync.Map
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		bucket := parts[0]
+		var key string
+		if len(parts) > 1 {
+			key = parts[1]
+		}
+
+		if key == "" && r.URL.Query().Get("list-type") == "2" {
+			listObjects(w, bucket, r.URL.Query().Get("prefix"), &store)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			data := make([]byte, r.ContentLength)
+			r.Body.Read(data)
+			store.Store(key, data)
+			w.Header().Set("ETag", `"etag"`)
+		case http.MethodHead:
+			data, ok := store.Load(key)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data.([]byte))))
+		case http.MethodGet:
+			data, ok := store.Load(key)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `<?xml version="1.0"?><Error><Code>NoSuchKey</Code><Message>missing</Message></Error>`)
+				return
+			}
+			body := data.([]byte)
+			start, end := 0, len(body)-1
+			if rng := r.Header.Get("Range"); rng != "" {
+				fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+				if end >= len(body) {
+					end = len(body) - 1
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+				w.WriteHeader(http.StatusPartialContent)
+			}
+			w.Write(body[start : end+1])
+		}
+	})
+	return httptest.NewServer(mux), &store
+}
+
+func listObjects(w http.ResponseWriter, bucket, prefix string, store *sync.Map) {
+	var contents strings.Builder
+	store.Range(func(k, v interface{}) bool {
+		key := k.(string)
+		if strings.HasPrefix(key, prefix) {
+			fmt.Fprintf(&contents, `<Contents><Key>%s</Key><Size>%d</Size><LastModified>2020-01-01T00:00:00.000Z</LastModified></Contents>`, key, len(v.([]byte)))
+		}
+		return true
+	})
+	fmt.Fprintf(w, `<?xml version="1.0"?><ListBucketResult><Name>%s</Name><Prefix>%s</Prefix><IsTruncated>false</IsTruncated>%s</ListBucketResult>`, bucket, prefix, contents.String())
+}
+
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	c, err := NewClient(
+		aws.NewConfig().
+			WithRegion("us-east-1").
+			WithEndpoint(server.URL).
+			WithS3ForcePathStyle(true).
+			WithDisableSSL(true).
+			WithCredentials(credentials.NewStaticCredentials("id", "secret", "")),
+	)
+	assert.Nil(t, err)
+	return c
+}
+
+func TestPutFileAndGetFile(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	data := []byte("hello world")
+
+	assert.Nil(t, c.PutFile("mybucket", "file.txt", data))
+	got, err := c.GetFile("mybucket", "file.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestExists(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	assert.False(t, c.Exists("mybucket", "missing.txt"))
+
+	assert.Nil(t, c.PutFile("mybucket", "present.txt", []byte("x")))
+	assert.True(t, c.Exists("mybucket", "present.txt"))
+}
+
+func TestFilesAtPath(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	assert.Nil(t, c.PutFile("mybucket", "prefix/a.txt", []byte("a")))
+	assert.Nil(t, c.PutFile("mybucket", "prefix/b.txt", []byte("bb")))
+	assert.Nil(t, c.PutFile("mybucket", "other/c.txt", []byte("ccc")))
+
+	files, err := c.FilesAtPath("mybucket", "prefix/")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(files))
+}
+
+func TestProcessAndUpdateFile(t *testing.T) {
+	server, _ := newTestServer()
+	defer server.Close()
+
+	c := newTestClient(t, server)
+	assert.Nil(t, c.PutFile("mybucket", "count.txt", []byte("1")))
+
+	err := c.ProcessAndUpdateFile("mybucket", "count.txt", func(file []byte) ([]byte, error) {
+		return []byte(string(file) + "1"), nil
+	})
+	assert.Nil(t, err)
+
+	got, err := c.GetFile("mybucket", "count.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "11", string(got))
+}